@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// maxHosts bounds how many addresses a single CIDR/range entry may expand
+// into, so a typo like 10.0.0.0/8 (or its IPv6 equivalent) doesn't
+// allocate tens of millions of strings. Set from -max-hosts; the default,
+// 65536, covers a /16 IPv4 network or a /112 IPv6 network.
+var maxHosts uint64 = 65536
+
+// parseCIDRNetwork parses a network in CIDR format, IPv4 or IPv6, to an
+// address list.
+func parseCIDRNetwork(ipRange string) ([]string, error) {
+	prefix, err := netip.ParsePrefix(ipRange)
+	if err != nil {
+		return nil, err
+	}
+	prefix = prefix.Masked()
+
+	hostBits := uint(prefix.Addr().BitLen() - prefix.Bits())
+	count := new(big.Int).Lsh(big.NewInt(1), hostBits)
+	if count.Cmp(new(big.Int).SetUint64(maxHosts)) > 0 {
+		return nil, fmt.Errorf("%s expands to more than -max-hosts=%d addresses, refusing", ipRange, maxHosts)
+	}
+
+	var addresses []string
+	for addr := prefix.Addr(); addr.IsValid() && prefix.Contains(addr); addr = addr.Next() {
+		addresses = append(addresses, formatHostPort(addr, ""))
+	}
+
+	return addresses, nil
+}
+
+// parseNetworkBlock parses networks in a "block" format to an address
+// list, IPv4 or IPv6. A format like this would be
+// 192.168.0.0-192.168.0.255 or 2001:db8::1-2001:db8::ff.
+func parseNetworkBlock(ipBlock string) ([]string, error) {
+	block := strings.TrimSpace(ipBlock)
+	edges := strings.SplitN(block, "-", 2)
+	if len(edges) != 2 {
+		return nil, fmt.Errorf("%q is not a valid block: expected \"start-end\"", ipBlock)
+	}
+
+	start, err := netip.ParseAddr(strings.TrimSpace(edges[0]))
+	if err != nil {
+		return nil, err
+	}
+	end, err := netip.ParseAddr(strings.TrimSpace(edges[1]))
+	if err != nil {
+		return nil, err
+	}
+	if start.Is4() != end.Is4() {
+		return nil, fmt.Errorf("%q mixes address families", ipBlock)
+	}
+	if end.Less(start) {
+		return nil, fmt.Errorf("%q: end address is before start address", ipBlock)
+	}
+
+	count := new(big.Int).Sub(addrToInt(end), addrToInt(start))
+	count.Add(count, big.NewInt(1))
+	if count.Cmp(new(big.Int).SetUint64(maxHosts)) > 0 {
+		return nil, fmt.Errorf("%s expands to more than -max-hosts=%d addresses, refusing", ipBlock, maxHosts)
+	}
+
+	var addresses []string
+	for addr := start; ; addr = addr.Next() {
+		addresses = append(addresses, formatHostPort(addr, ""))
+		if addr == end {
+			break
+		}
+	}
+
+	return addresses, nil
+}
+
+// addrToInt returns addr's numeric value as a big.Int, for range-size and
+// ordering arithmetic that must work across both address families.
+func addrToInt(addr netip.Addr) *big.Int {
+	if addr.Is4() {
+		b := addr.As4()
+		return new(big.Int).SetBytes(b[:])
+	}
+	b := addr.As16()
+	return new(big.Int).SetBytes(b[:])
+}
+
+// formatHostPort renders addr (bracketing it if it's IPv6) with an
+// optional port, producing a string suitable for use as a URL host.
+func formatHostPort(addr netip.Addr, port string) string {
+	host := addr.String()
+	if addr.Is6() && !addr.Is4In6() {
+		host = "[" + host + "]"
+	}
+	if port == "" {
+		return host
+	}
+	return host + ":" + port
+}
+
+// parseSingleAddress parses a single address, optionally carrying a port
+// override (192.168.0.4:8443, [2001:db8::1]:8443), into its canonical
+// URL-host form.
+func parseSingleAddress(address string) ([]string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host, port = address, ""
+		host = strings.TrimPrefix(strings.TrimSuffix(host, "]"), "[")
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a valid address", address)
+	}
+
+	return []string{formatHostPort(addr, port)}, nil
+}
+
+// Parses given addresses into an address list. Accepts the following
+// formats:
+//   - 192.168.0.0/24 or 2001:db8::/48 (CIDR, IPv4 or IPv6)
+//   - 192.168.0.1-192.168.0.255 (range, IPv4 or IPv6)
+//   - 192.168.0.4 or 2001:db8::1 (just an address)
+//   - 192.168.0.4:8443 or [2001:db8::1]:8443 (an address with a port
+//     override, carried through to performTest so the candidate is
+//     probed on that port instead of the target URL's)
+func parseAddresses(address string) ([]string, error) {
+	var (
+		parsedRange []string
+		err         error
+	)
+	if strings.Contains(address, "/") {
+		parsedRange, err = parseCIDRNetwork(address)
+	} else if strings.Contains(address, "-") {
+		parsedRange, err = parseNetworkBlock(address)
+	} else {
+		parsedRange, err = parseSingleAddress(address)
+	}
+
+	if err != nil {
+		ErrorLogger.Printf("Unable to parse \"%s\": %s. Skipping...\n", address, err)
+		err = nil
+	}
+	return parsedRange, nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestParseCIDRNetwork(t *testing.T) {
+	defer func(prev uint64) { maxHosts = prev }(maxHosts)
+
+	tests := []struct {
+		name    string
+		input   string
+		maxHost uint64
+		want    []string
+		wantErr bool
+	}{
+		{name: "ipv4 /30", input: "192.168.0.0/30", maxHost: 65536, want: []string{
+			"192.168.0.0", "192.168.0.1", "192.168.0.2", "192.168.0.3",
+		}},
+		{name: "ipv6 /126", input: "2001:db8::/126", maxHost: 65536, want: []string{
+			"[2001:db8::]", "[2001:db8::1]", "[2001:db8::2]", "[2001:db8::3]",
+		}},
+		{name: "unmasked host bits are masked off", input: "192.168.0.5/30", maxHost: 65536, want: []string{
+			"192.168.0.4", "192.168.0.5", "192.168.0.6", "192.168.0.7",
+		}},
+		{name: "exactly at max-hosts boundary", input: "192.168.0.0/30", maxHost: 4, want: []string{
+			"192.168.0.0", "192.168.0.1", "192.168.0.2", "192.168.0.3",
+		}},
+		{name: "one over max-hosts boundary rejected", input: "192.168.0.0/30", maxHost: 3, wantErr: true},
+		{name: "invalid CIDR", input: "not-a-cidr", maxHost: 65536, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxHosts = tt.maxHost
+			got, err := parseCIDRNetwork(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseCIDRNetwork(%q) = %v, want error", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCIDRNetwork(%q) unexpected error: %v", tt.input, err)
+			}
+			if !equalSlices(got, tt.want) {
+				t.Fatalf("parseCIDRNetwork(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNetworkBlock(t *testing.T) {
+	defer func(prev uint64) { maxHosts = prev }(maxHosts)
+
+	tests := []struct {
+		name    string
+		input   string
+		maxHost uint64
+		want    []string
+		wantErr bool
+	}{
+		{name: "ipv4 range", input: "192.168.0.1-192.168.0.3", maxHost: 65536, want: []string{
+			"192.168.0.1", "192.168.0.2", "192.168.0.3",
+		}},
+		{name: "ipv6 range", input: "2001:db8::1-2001:db8::3", maxHost: 65536, want: []string{
+			"[2001:db8::1]", "[2001:db8::2]", "[2001:db8::3]",
+		}},
+		{name: "single-address range", input: "192.168.0.1-192.168.0.1", maxHost: 65536, want: []string{
+			"192.168.0.1",
+		}},
+		{name: "mixed family rejected", input: "192.168.0.1-2001:db8::1", maxHost: 65536, wantErr: true},
+		{name: "end before start rejected", input: "192.168.0.3-192.168.0.1", maxHost: 65536, wantErr: true},
+		{name: "over max-hosts rejected", input: "192.168.0.1-192.168.0.3", maxHost: 2, wantErr: true},
+		{name: "missing separator", input: "192.168.0.1", maxHost: 65536, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxHosts = tt.maxHost
+			got, err := parseNetworkBlock(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseNetworkBlock(%q) = %v, want error", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseNetworkBlock(%q) unexpected error: %v", tt.input, err)
+			}
+			if !equalSlices(got, tt.want) {
+				t.Fatalf("parseNetworkBlock(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSingleAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "ipv4", input: "192.168.0.4", want: "192.168.0.4"},
+		{name: "ipv4 with port", input: "192.168.0.4:8443", want: "192.168.0.4:8443"},
+		{name: "ipv6", input: "2001:db8::1", want: "[2001:db8::1]"},
+		{name: "bracketed ipv6 without port", input: "[2001:db8::1]", want: "[2001:db8::1]"},
+		{name: "bracketed ipv6 with port", input: "[2001:db8::1]:8443", want: "[2001:db8::1]:8443"},
+		{name: "invalid address", input: "not-an-address", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSingleAddress(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseSingleAddress(%q) = %v, want error", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSingleAddress(%q) unexpected error: %v", tt.input, err)
+			}
+			if len(got) != 1 || got[0] != tt.want {
+				t.Fatalf("parseSingleAddress(%q) = %v, want [%s]", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAddresses(t *testing.T) {
+	defer func(prev uint64) { maxHosts = prev }(maxHosts)
+	maxHosts = 65536
+
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{name: "cidr", input: "192.168.0.0/30", want: []string{
+			"192.168.0.0", "192.168.0.1", "192.168.0.2", "192.168.0.3",
+		}},
+		{name: "range", input: "192.168.0.1-192.168.0.2", want: []string{
+			"192.168.0.1", "192.168.0.2",
+		}},
+		{name: "single address", input: "192.168.0.4", want: []string{"192.168.0.4"}},
+		{name: "invalid entry is skipped, not erred", input: "not-an-address", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAddresses(tt.input)
+			if err != nil {
+				t.Fatalf("parseAddresses(%q) returned error %v, want nil (errors are logged, not returned)", tt.input, err)
+			}
+			if !equalSlices(got, tt.want) {
+				t.Fatalf("parseAddresses(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func equalSlices(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFormatHostPort(t *testing.T) {
+	if got := formatHostPort(mustParseAddr(t, "192.168.0.1"), ""); got != "192.168.0.1" {
+		t.Fatalf("formatHostPort(v4, \"\") = %q", got)
+	}
+	if got := formatHostPort(mustParseAddr(t, "192.168.0.1"), "80"); got != "192.168.0.1:80" {
+		t.Fatalf("formatHostPort(v4, \"80\") = %q", got)
+	}
+	if got := formatHostPort(mustParseAddr(t, "2001:db8::1"), ""); got != "[2001:db8::1]" {
+		t.Fatalf("formatHostPort(v6, \"\") = %q", got)
+	}
+	if got := formatHostPort(mustParseAddr(t, "2001:db8::1"), "80"); got != "[2001:db8::1]:80" {
+		t.Fatalf("formatHostPort(v6, \"80\") = %q", got)
+	}
+}
+
+func mustParseAddr(t *testing.T, s string) netip.Addr {
+	t.Helper()
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		t.Fatalf("parseAddr(%q): %v", s, err)
+	}
+	return a
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// retryBaseDelay is the initial backoff delay applied after the first
+// retryable failure; it doubles on each subsequent attempt.
+const retryBaseDelay = 200 * time.Millisecond
+
+// rateLimiter is a simple token-bucket limiter shared across workers to
+// cap the aggregate request rate against the target.
+type rateLimiter struct {
+	tokens chan struct{}
+}
+
+// newRateLimiter returns a limiter that allows roughly rps requests per
+// second in aggregate across every caller of Wait.
+func newRateLimiter(rps float64) *rateLimiter {
+	interval := time.Duration(float64(time.Second) / rps)
+	if interval <= 0 {
+		interval = time.Nanosecond
+	}
+
+	l := &rateLimiter{tokens: make(chan struct{}, 1)}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			select {
+			case l.tokens <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return l
+}
+
+// Wait blocks until a token is available.
+func (l *rateLimiter) Wait() {
+	<-l.tokens
+}
+
+// isRetryableError reports whether err is a network timeout, the only
+// error class that's safe to retry. HTTP status errors returned by the
+// RequestClient are excluded: a 403 from a WAF is a result, not a
+// transient failure. Non-timeout network errors are excluded too: a
+// "connection refused" on a closed port is a definitive result of a
+// /16 or ASN sweep, not a transient failure, and retrying it just burns
+// retries*backoff on every closed port in the range.
+func isRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// discoveryHTTPTimeout bounds a single request to a discovery/ASN data
+// source; these run once per scan, not per candidate, so a generous
+// timeout is fine.
+const discoveryHTTPTimeout = 30 * time.Second
+
+// discoverySource supplies candidate hostnames for a scan from a
+// Certificate Transparency log, passive DNS, or a local file, bypassing
+// -l/stdin. Implementations back -discover-source.
+type discoverySource interface {
+	// Discover returns every hostname the source has associated with
+	// apex, unresolved.
+	Discover(apex string) ([]string, error)
+}
+
+// newDiscoverySource builds the discoverySource named by name. path is
+// only used by "file".
+func newDiscoverySource(name, path string) (discoverySource, error) {
+	switch name {
+	case "crtsh":
+		return crtshSource{httpClient: &http.Client{Timeout: discoveryHTTPTimeout}}, nil
+	case "dnsdb":
+		return dnsdbSource{
+			httpClient: &http.Client{Timeout: discoveryHTTPTimeout},
+			apiKey:     os.Getenv("DNSDB_API_KEY"),
+		}, nil
+	case "file":
+		if path == "" {
+			return nil, fmt.Errorf("-discover-source=file requires -discover-file")
+		}
+		return fileSource{path: path}, nil
+	default:
+		return nil, fmt.Errorf("unknown -discover-source %q, expected crtsh, dnsdb or file", name)
+	}
+}
+
+// apexDomain trims host down to its last two labels, e.g.
+// "www.example.com" -> "example.com". It's deliberately simple (no
+// public-suffix list) since CT/passive-DNS lookups key on the registered
+// domain, not a precise eTLD+1.
+func apexDomain(host string) string {
+	labels := strings.Split(host, ".")
+	if len(labels) <= 2 {
+		return host
+	}
+	return strings.Join(labels[len(labels)-2:], ".")
+}
+
+// crtshSource queries crt.sh's JSON endpoint for certificates whose SANs
+// cover apex, and returns every SAN found across them.
+type crtshSource struct {
+	httpClient *http.Client
+}
+
+type crtshEntry struct {
+	NameValue string `json:"name_value"`
+}
+
+func (s crtshSource) Discover(apex string) ([]string, error) {
+	reqURL := fmt.Sprintf("https://crt.sh/?q=%s&output=json", url.QueryEscape("%."+apex))
+	resp, err := s.httpClient.Get(reqURL)
+	if err != nil {
+		return nil, fmt.Errorf("crt.sh query failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []crtshEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("crt.sh returned unparsable JSON: %w", err)
+	}
+
+	seen := make(map[string]struct{})
+	var hostnames []string
+	for _, entry := range entries {
+		for _, name := range strings.Split(entry.NameValue, "\n") {
+			name = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "*.")
+			if name == "" {
+				continue
+			}
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			seen[name] = struct{}{}
+			hostnames = append(hostnames, name)
+		}
+	}
+	return hostnames, nil
+}
+
+// dnsdbSource queries a Farsight DNSDB-compatible passive DNS API for
+// historical records under apex. Requires DNSDB_API_KEY.
+type dnsdbSource struct {
+	httpClient *http.Client
+	apiKey     string
+	baseURL    string // empty defaults to the Farsight SaaS endpoint
+}
+
+type dnsdbRecord struct {
+	RRName string `json:"rrname"`
+}
+
+func (s dnsdbSource) Discover(apex string) ([]string, error) {
+	if s.apiKey == "" {
+		return nil, fmt.Errorf("-discover-source=dnsdb requires the DNSDB_API_KEY environment variable")
+	}
+	baseURL := s.baseURL
+	if baseURL == "" {
+		baseURL = "https://api.dnsdb.info"
+	}
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/lookup/rrset/name/*.%s?limit=10000", baseURL, apex), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-API-Key", s.apiKey)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("dnsdb query failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// DNSDB returns newline-delimited JSON, one record per line.
+	seen := make(map[string]struct{})
+	var hostnames []string
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var record dnsdbRecord
+		if err := dec.Decode(&record); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("dnsdb returned unparsable JSON: %w", err)
+		}
+		name := strings.ToLower(strings.TrimSuffix(record.RRName, "."))
+		if name == "" {
+			continue
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		hostnames = append(hostnames, name)
+	}
+	return hostnames, nil
+}
+
+// fileSource reads newline-separated hostnames from a local file. It
+// exists for testability and offline use; it ignores apex.
+type fileSource struct {
+	path string
+}
+
+func (s fileSource) Discover(_ string) ([]string, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var hostnames []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		hostnames = append(hostnames, line)
+	}
+	return hostnames, nil
+}
+
+// resolveHostnames resolves each hostname to its A/AAAA addresses,
+// formatted for use as a URL host (IPv6 literals bracketed). Hostnames
+// that don't resolve are logged and skipped, same as a bad parseAddresses
+// entry. Subject to the same -max-hosts guard as parseCIDRNetwork/
+// parseNetworkBlock: CT logs routinely return tens of thousands of SANs
+// for a non-trivial domain, and resolving (let alone scanning) all of
+// them is never what -max-hosts's default is meant to allow.
+func resolveHostnames(hostnames []string) []string {
+	if uint64(len(hostnames)) > maxHosts {
+		ErrorLogger.Printf("-discover found %d hostnames, more than -max-hosts=%d; keeping the first %d\n", len(hostnames), maxHosts, maxHosts)
+		hostnames = hostnames[:maxHosts]
+	}
+
+	seen := make(map[string]struct{})
+	var addresses []string
+	for _, hostname := range hostnames {
+		if uint64(len(addresses)) >= maxHosts {
+			ErrorLogger.Printf("-discover resolved %d addresses, reached -max-hosts=%d; stopping\n", len(addresses), maxHosts)
+			break
+		}
+
+		ips, err := net.LookupHost(hostname)
+		if err != nil {
+			ErrorLogger.Printf("Unable to resolve \"%s\": %s. Skipping...\n", hostname, err)
+			continue
+		}
+		for _, ip := range ips {
+			if uint64(len(addresses)) >= maxHosts {
+				break
+			}
+			addr, err := netip.ParseAddr(ip)
+			if err != nil {
+				continue
+			}
+			formatted := formatHostPort(addr, "")
+			if _, ok := seen[formatted]; ok {
+				continue
+			}
+			seen[formatted] = struct{}{}
+			addresses = append(addresses, formatted)
+		}
+	}
+	return addresses
+}
+
+// asnSource resolves an ASN to the IP prefixes it announces, in CIDR
+// form. Implementations back -asn-source.
+type asnSource interface {
+	Prefixes(asn string) ([]string, error)
+}
+
+// newASNSource builds the asnSource named by name. path is only used by
+// "file".
+func newASNSource(name, path string) (asnSource, error) {
+	switch name {
+	case "bgpview":
+		return bgpViewSource{httpClient: &http.Client{Timeout: discoveryHTTPTimeout}}, nil
+	case "file":
+		if path == "" {
+			return nil, fmt.Errorf("-asn-source=file requires -discover-asn-file")
+		}
+		return fileASNSource{path: path}, nil
+	default:
+		return nil, fmt.Errorf("unknown -asn-source %q, expected bgpview or file", name)
+	}
+}
+
+// bgpViewSource queries the bgpview.io public API for an ASN's announced
+// prefixes, resolving an organization name to an ASN first via bgpview's
+// search endpoint when asn isn't already numeric.
+type bgpViewSource struct {
+	httpClient *http.Client
+}
+
+type bgpViewPrefix struct {
+	Prefix string `json:"prefix"`
+}
+
+type bgpViewASNResponse struct {
+	Data struct {
+		IPv4Prefixes []bgpViewPrefix `json:"ipv4_prefixes"`
+		IPv6Prefixes []bgpViewPrefix `json:"ipv6_prefixes"`
+	} `json:"data"`
+}
+
+type bgpViewSearchResponse struct {
+	Data struct {
+		ASNs []struct {
+			ASN int `json:"asn"`
+		} `json:"asns"`
+	} `json:"data"`
+}
+
+// resolveASN looks up the ASN bgpview considers the best match for an
+// organization/name search term.
+func (s bgpViewSource) resolveASN(term string) (string, error) {
+	resp, err := s.httpClient.Get(fmt.Sprintf("https://api.bgpview.io/search?query_term=%s", url.QueryEscape(term)))
+	if err != nil {
+		return "", fmt.Errorf("bgpview search failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var parsed bgpViewSearchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return "", fmt.Errorf("bgpview search returned unparsable JSON: %w", err)
+	}
+	if len(parsed.Data.ASNs) == 0 {
+		return "", fmt.Errorf("bgpview search found no ASN matching %q", term)
+	}
+	return strconv.Itoa(parsed.Data.ASNs[0].ASN), nil
+}
+
+func (s bgpViewSource) Prefixes(asn string) ([]string, error) {
+	number := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(asn)), "AS")
+	if _, err := strconv.Atoi(number); err != nil {
+		resolved, err := s.resolveASN(asn)
+		if err != nil {
+			return nil, err
+		}
+		number = resolved
+	}
+
+	resp, err := s.httpClient.Get(fmt.Sprintf("https://api.bgpview.io/asn/%s/prefixes", number))
+	if err != nil {
+		return nil, fmt.Errorf("bgpview query failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var parsed bgpViewASNResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("bgpview returned unparsable JSON: %w", err)
+	}
+
+	prefixes := make([]string, 0, len(parsed.Data.IPv4Prefixes)+len(parsed.Data.IPv6Prefixes))
+	for _, p := range parsed.Data.IPv4Prefixes {
+		prefixes = append(prefixes, p.Prefix)
+	}
+	for _, p := range parsed.Data.IPv6Prefixes {
+		prefixes = append(prefixes, p.Prefix)
+	}
+	return prefixes, nil
+}
+
+// fileASNSource reads newline-separated CIDR prefixes from a local file,
+// for testability and offline use; it ignores asn.
+type fileASNSource struct {
+	path string
+}
+
+func (s fileASNSource) Prefixes(_ string) ([]string, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var prefixes []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		prefixes = append(prefixes, line)
+	}
+	return prefixes, nil
+}
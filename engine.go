@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// ProbeResponse is everything performTest needs out of a single HTTP
+// probe in order to score and report a candidate. PeerCertificates is
+// only populated by engines that expose the underlying TLS connection
+// state; the fasthttp engine currently leaves it nil, so -weights cert
+// always scores 0 there.
+type ProbeResponse struct {
+	StatusCode       int
+	Body             string
+	HeaderNames      []string
+	PeerCertificates []*x509.Certificate
+}
+
+// RequestClient performs a single vhost-comparison probe: it requests u
+// while sending vhost as the Host header, and returns the response.
+// Implementations back the -engine flag.
+type RequestClient interface {
+	Do(method, u, vhost, cookieString string) (ProbeResponse, error)
+}
+
+// netRequestClient is the default engine, backed by the global net/http
+// Client. It supports HTTP/HTTPS/SOCKS5 proxies and is the right choice
+// whenever a proxy is required or the range being scanned is small.
+type netRequestClient struct{}
+
+func (netRequestClient) Do(method, u, vhost, cookieString string) (ProbeResponse, error) {
+	return doRequest(method, u, vhost, cookieString)
+}
+
+// fasthttpRequestClient is the high-throughput engine used for scans over
+// large address ranges. It keeps one fasthttp.HostClient per candidate
+// address so the TCP/TLS connection is reused across probes, pinning the
+// dial target to that address while sending the original vhost as the
+// Host header and TLS SNI. fasthttp's AcquireRequest/AcquireResponse
+// pooling means fewer per-probe heap allocations than -engine net, not
+// zero (see BenchmarkFasthttpEngine in engine_test.go).
+// Proxies are not supported; use -engine net for those.
+type fasthttpRequestClient struct {
+	mu      sync.Mutex
+	clients map[string]*fasthttp.HostClient
+	timeout time.Duration
+}
+
+func newFasthttpRequestClient(timeout time.Duration) *fasthttpRequestClient {
+	return &fasthttpRequestClient{
+		clients: make(map[string]*fasthttp.HostClient),
+		timeout: timeout,
+	}
+}
+
+// hostClient returns the HostClient pinned to addr, creating and caching
+// it on first use.
+func (c *fasthttpRequestClient) hostClient(addr string, isTLS bool, vhost string) *fasthttp.HostClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if hc, ok := c.clients[addr]; ok {
+		return hc
+	}
+	hc := &fasthttp.HostClient{
+		Addr:  addr,
+		IsTLS: isTLS,
+		TLSConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			ServerName:         vhost,
+		},
+	}
+	c.clients[addr] = hc
+	return hc
+}
+
+func (c *fasthttpRequestClient) Do(method, u, vhost, cookieString string) (ProbeResponse, error) {
+	target, err := url.Parse(u)
+	if err != nil {
+		return ProbeResponse{}, err
+	}
+
+	addr := target.Host
+	if target.Port() == "" {
+		defaultPort := "80"
+		if target.Scheme == "https" {
+			defaultPort = "443"
+		}
+		addr = net.JoinHostPort(addr, defaultPort)
+	}
+	hc := c.hostClient(addr, target.Scheme == "https", vhost)
+
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.SetRequestURI(target.RequestURI())
+	req.Header.SetMethod(method)
+	req.Header.SetHost(vhost)
+	req.Header.Set("User-Agent", userAgent)
+	if len(cookieString) > 0 {
+		req.Header.Set("Cookie", cookieString)
+	}
+
+	if err := hc.DoTimeout(req, resp, c.timeout); err != nil {
+		return ProbeResponse{}, err
+	}
+
+	statusCode := resp.StatusCode()
+	if statusCode >= 300 && !ValidStatusCodes[statusCode] {
+		return ProbeResponse{}, fmt.Errorf("server error: status %d", statusCode)
+	}
+
+	var headerNames []string
+	resp.Header.VisitAll(func(key, _ []byte) {
+		headerNames = append(headerNames, string(key))
+	})
+
+	return ProbeResponse{StatusCode: statusCode, Body: string(resp.Body()), HeaderNames: headerNames}, nil
+}
@@ -2,24 +2,27 @@ package main
 
 import (
 	"bufio"
+	"crypto/sha256"
 	"crypto/tls"
-	"encoding/binary"
+	"crypto/x509"
 	"flag"
 	"fmt"
 	"github.com/adrg/strutil"
 	"github.com/adrg/strutil/metrics"
 	"io/ioutil"
 	"log"
-	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
+const userAgent = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/51.0.2704.103 Safari/537.36"
+
 var (
 	Client           http.Client
 	ErrorLogger      *log.Logger
@@ -48,8 +51,25 @@ func main() {
 	cookieString := flag.String("c", "", "Cookie string to send with every request. Helps to deal with WAFs blocking automated requests")
 	validStatusCodes := flag.String("s", "", "Valid status codes other than 2xx")
 	responseTimeout := flag.String("t", "10s", "Timeout in seconds while checking hosts")
+	engine := flag.String("engine", "net", "HTTP engine used to probe candidates: net or fasthttp. fasthttp reuses connections per candidate IP and is recommended for large ranges")
+	concurrency := flag.Int("concurrency", 100, "Number of concurrent workers probing addresses")
+	rps := flag.Float64("rps", 0, "Maximum requests per second across all workers (0 = unlimited)")
+	retries := flag.Int("retries", 2, "Retries for connection/timeout errors; HTTP status codes are never retried")
+	maxHostsFlag := flag.Uint64("max-hosts", 65536, "Refuse to expand a single CIDR/range into more than this many addresses (default covers a /16 IPv4 or /112 IPv6 network)")
+	outputFormat := flag.String("o", "text", "Output format: text, json, jsonl or csv")
+	weightsFlag := flag.String("weights", "", "Composite score weights as key=value pairs, e.g. body=0.6,headers=0.2,status=0.1,cert=0.1 (default: body=1, others=0)")
+	mustMatchFlag := flag.String("must-match", "", "Regex the candidate body must match to score above 0")
+	threshold := flag.Float64("threshold", 0, "Only report candidates whose composite score is at least this value")
+	verbose := flag.Bool("v", false, "Include each signal's subscore alongside the composite score")
+	discover := flag.Bool("discover", false, "Populate the candidate list from Certificate Transparency logs / passive DNS instead of -l/stdin")
+	discoverSource := flag.String("discover-source", "crtsh", "Source for -discover: crtsh, dnsdb or file")
+	discoverFile := flag.String("discover-file", "", "Newline-separated hostname file, used when -discover-source=file")
+	discoverASN := flag.String("discover-asn", "", "ASN (e.g. AS13335) whose announced prefixes are added to the candidate list")
+	asnSourceFlag := flag.String("asn-source", "bgpview", "BGP data source for -discover-asn: bgpview or file")
+	asnFile := flag.String("discover-asn-file", "", "Newline-separated CIDR prefix file, used when -asn-source=file")
 
 	flag.Parse()
+	maxHosts = *maxHostsFlag
 
 	// Base URL / Target positional argument parsing
 	if flag.NArg() != 1 {
@@ -89,25 +109,52 @@ func main() {
 	}
 	Client.Timeout = timeoutDuration
 
-	// Begin test execution
+	// Select HTTP engine
+	var requestClient RequestClient
+	switch *engine {
+	case "net":
+		requestClient = netRequestClient{}
+	case "fasthttp":
+		if len(*httpProxy) > 0 {
+			ErrorLogger.Fatalln("-engine fasthttp does not support -proxy, use -engine net instead")
+		}
+		requestClient = newFasthttpRequestClient(timeoutDuration)
+	default:
+		ErrorLogger.Fatalf("unknown engine \"%s\", expected net or fasthttp", *engine)
+	}
 
-	var (
-		addresses []string
-	)
+	if *concurrency < 1 {
+		ErrorLogger.Fatalln("-concurrency must be at least 1")
+	}
 
-	// Posible Origin Server Addresses reading
-	if len(*addressList) > 0 {
-		addresses, err = getAddressesFromFile(*addressList)
-		if err != nil {
-			ErrorLogger.Fatalf("Unable to read \"%s\"", addressList)
-		}
-	} else {
-		addresses, err = getAddressesFromStdin()
+	var limiter *rateLimiter
+	if *rps > 0 {
+		limiter = newRateLimiter(*rps)
+	}
+
+	sink, err := newResultSink(*outputFormat)
+	if err != nil {
+		ErrorLogger.Fatalln(err)
+	}
+
+	weights, err := parseScoreWeights(*weightsFlag)
+	if err != nil {
+		ErrorLogger.Fatalln(err)
+	}
+	if weights.Cert > 0 && *engine == "fasthttp" {
+		ErrorLogger.Printf("-weights cert=%.2f has no effect with -engine fasthttp, which does not expose peer certificates; use -engine net to score cert\n", weights.Cert)
+	}
+
+	var mustMatch *regexp.Regexp
+	if len(*mustMatchFlag) > 0 {
+		mustMatch, err = regexp.Compile(*mustMatchFlag)
 		if err != nil {
 			ErrorLogger.Fatalln(err)
 		}
 	}
 
+	// Begin test execution
+
 	// VHost and path parsing
 	u, err := url.Parse(baseUrl)
 	if err != nil {
@@ -115,8 +162,53 @@ func main() {
 	}
 	vhost := u.Host
 
+	// Candidate address sourcing: -discover takes priority over -l/stdin
+	var addresses []string
+	switch {
+	case *discover:
+		source, err := newDiscoverySource(*discoverSource, *discoverFile)
+		if err != nil {
+			ErrorLogger.Fatalln(err)
+		}
+		hostnames, err := source.Discover(apexDomain(u.Hostname()))
+		if err != nil {
+			ErrorLogger.Fatalln(err)
+		}
+		addresses = resolveHostnames(hostnames)
+	case len(*addressList) > 0:
+		addresses, err = getAddressesFromFile(*addressList)
+		if err != nil {
+			ErrorLogger.Fatalf("Unable to read \"%s\"", *addressList)
+		}
+	default:
+		addresses, err = getAddressesFromStdin()
+		if err != nil {
+			ErrorLogger.Fatalln(err)
+		}
+	}
+
+	// -discover-asn sweeps the target's own hosting range in addition to
+	// whatever -discover/-l/stdin produced.
+	if len(*discoverASN) > 0 {
+		source, err := newASNSource(*asnSourceFlag, *asnFile)
+		if err != nil {
+			ErrorLogger.Fatalln(err)
+		}
+		prefixes, err := source.Prefixes(*discoverASN)
+		if err != nil {
+			ErrorLogger.Fatalln(err)
+		}
+		for _, prefix := range prefixes {
+			expanded, err := parseAddresses(prefix)
+			if err != nil {
+				continue
+			}
+			addresses = append(addresses, expanded...)
+		}
+	}
+
 	// Original request
-	originalBody, err := doRequest(http.MethodGet, u.String(), vhost, *cookieString)
+	originalResponse, err := doRequest(http.MethodGet, u.String(), vhost, *cookieString)
 	if err != nil {
 		ErrorLogger.Fatalf(err.Error())
 	}
@@ -124,15 +216,53 @@ func main() {
 	comparator.CaseSensitive = true
 	comparator.NgramSize = 8
 
-	var wg sync.WaitGroup
+	cfg := scanConfig{
+		client:     requestClient,
+		limiter:    limiter,
+		retries:    *retries,
+		comparator: comparator,
+		weights:    weights,
+		mustMatch:  mustMatch,
+		verbose:    *verbose,
+	}
 
-	for _, address := range addresses {
-		wg.Add(1)
-		go performTest(originalBody, *u, comparator, address, &wg, *cookieString)
+	addressCh := make(chan string)
+	resultCh := make(chan ProbeResult)
+
+	// Worker pool: bounded to -concurrency so large ranges don't exhaust
+	// local sockets/file descriptors.
+	var workers sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for address := range addressCh {
+				resultCh <- performTest(cfg, originalResponse, *u, address, *cookieString)
+			}
+		}()
 	}
 
-	// Wait for every goroutine to finish
-	wg.Wait()
+	go func() {
+		for _, address := range addresses {
+			addressCh <- address
+		}
+		close(addressCh)
+	}()
+
+	go func() {
+		workers.Wait()
+		close(resultCh)
+	}()
+
+	// The sink is the sole writer of stdout, so results from concurrent
+	// workers never interleave.
+	for result := range resultCh {
+		if result.Error == "" && result.Similarity < *threshold {
+			continue
+		}
+		sink.write(result)
+	}
+	sink.finish()
 }
 
 // Reads and parses a file with IPs, ranges and networks in CIDR format
@@ -145,6 +275,10 @@ func getAddressesFromFile(filename string) ([]string, error) {
 	fileLines := strings.Split(string(f), "\n")
 
 	for _, fileLine := range fileLines {
+		fileLine = strings.TrimSpace(fileLine)
+		if fileLine == "" {
+			continue
+		}
 		parsedAddresses, _ := parseAddresses(fileLine)
 		addresses = append(addresses, parsedAddresses...)
 	}
@@ -157,110 +291,101 @@ func getAddressesFromStdin() ([]string, error) {
 	var addresses []string
 	sc := bufio.NewScanner(os.Stdin)
 	for sc.Scan() {
-		parsedAddresses, _ := parseAddresses(sc.Text())
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		parsedAddresses, _ := parseAddresses(line)
 		addresses = append(addresses, parsedAddresses...)
 	}
 	return addresses, nil
 }
 
-// Worker to make a request and compare it
-func performTest(originalBody string, u url.URL, comparator strutil.StringMetric, address string, wg *sync.WaitGroup, cookieString string) {
-	defer wg.Done()
-	vhost := u.Host
-	u.Host = address
-	checkedBody, err := doRequest(http.MethodGet, u.String(), vhost, cookieString)
-
-	if err != nil {
-
-	} else {
-		similarity := strutil.Similarity(checkedBody, originalBody, comparator)
-		fmt.Printf("%-17s%.2f%%\n", address, similarity*100)
-	}
+// ProbeResult is the machine-readable outcome of probing a single
+// candidate address, as emitted by -o json/jsonl/csv.
+type ProbeResult struct {
+	Address       string     `json:"address"`
+	VHost         string     `json:"vhost"`
+	Status        int        `json:"status"`
+	Similarity    float64    `json:"similarity"`
+	Subscores     *subscores `json:"subscores,omitempty"`
+	BodySHA256    string     `json:"body_sha256,omitempty"`
+	ContentLength int64      `json:"content_length"`
+	ElapsedMS     int64      `json:"elapsed_ms"`
+	Error         string     `json:"error,omitempty"`
 }
 
-// Parses networks in CIDR format to an address list
-func parseCIDRNetwork(ipRange string) ([]string, error) {
-	var addresses []string
-	_, ipv4Net, err := net.ParseCIDR(ipRange)
-	if err != nil {
-		return nil, err
-	}
-
-	mask := binary.BigEndian.Uint32(ipv4Net.Mask)
-	start := binary.BigEndian.Uint32(ipv4Net.IP)
-	end := (start & mask) | (mask ^ 0xffffffff)
-
-	for i := start; i < end; i++ {
-		ip := make(net.IP, 4)
-		binary.BigEndian.PutUint32(ip, i)
-		addresses = append(addresses, ip.String())
-	}
-
-	return addresses, nil
+// scanConfig bundles the settings shared by every performTest call in a
+// run: the engine, retry/rate-limit policy, and scoring configuration.
+type scanConfig struct {
+	client     RequestClient
+	limiter    *rateLimiter
+	retries    int
+	comparator strutil.StringMetric
+	weights    scoreWeights
+	mustMatch  *regexp.Regexp
+	verbose    bool
 }
 
-// Parses networks in a "block" format to an IP address list. A format like
-// this would be 192.168.0.0-192.168.0.255
-func parseNetworkBlock(ipBlock string) ([]string, error) {
-	block := strings.TrimSpace(ipBlock)
-	edges := strings.Split(block, "-")
-	if len(edges) != 2 {
-		ErrorLogger.Panicf("\"%s\" is not a valid block. Missing or more than 1 slash\n")
-	}
-
-	// Block start/end parsing
-	ipv4AddrStart := net.ParseIP(edges[0])
-	start := binary.BigEndian.Uint32(ipv4AddrStart.To4())
-	ipv4AddrEnd := net.ParseIP(edges[1])
-	end := binary.BigEndian.Uint32(ipv4AddrEnd.To4())
-
-	// IP calculation
-	var addresses []string
-	for i := start; i <= end; i++ {
-		ip := make(net.IP, 4)
-		binary.BigEndian.PutUint32(ip, i)
-		addresses = append(addresses, ip.String())
-	}
-
-	return addresses, nil
-}
+// Worker to make a request and compare it against original. Connection/
+// timeout errors are retried up to cfg.retries times with exponential
+// backoff; HTTP status errors returned by the RequestClient are not,
+// since they're a result rather than a transient failure.
+func performTest(cfg scanConfig, original ProbeResponse, u url.URL, address string, cookieString string) ProbeResult {
+	vhost := u.Host
+	u.Host = address
 
-// Parses given addresses into an IP list. Accepts the following formats:
-//   - 192.168.0.0/24
-//   - 192.168.0.1 - 192.168.0.255
-//   - 192.168.0.4 (Just an IP)
-func parseAddresses(address string) ([]string, error) {
 	var (
-		parsedRange []string
-		err         error
+		resp ProbeResponse
+		err  error
 	)
-	if strings.Contains(address, "/") {
-		parsedRange, err = parseCIDRNetwork(address)
-	} else if strings.Contains(address, "-") {
-		parsedRange, err = parseNetworkBlock(address)
-		if err != nil {
-			println(err.Error())
+	start := time.Now()
+	backoff := retryBaseDelay
+	for attempt := 0; attempt <= cfg.retries; attempt++ {
+		if cfg.limiter != nil {
+			cfg.limiter.Wait()
+		}
+		resp, err = cfg.client.Do(http.MethodGet, u.String(), vhost, cookieString)
+		if err == nil || !isRetryableError(err) {
+			break
+		}
+		if attempt < cfg.retries {
+			time.Sleep(backoff)
+			backoff *= 2
 		}
-	} else {
-		parsedRange = []string{address}
 	}
 
+	result := ProbeResult{
+		Address:   address,
+		VHost:     vhost,
+		ElapsedMS: time.Since(start).Milliseconds(),
+	}
 	if err != nil {
-		ErrorLogger.Printf("Unable to parse \"%s\". Skipping...\n", address)
-		err = nil
+		result.Error = err.Error()
+		return result
 	}
-	return parsedRange, nil
+
+	composite, sub := score(cfg.comparator, cfg.weights, original, resp, vhost, cfg.mustMatch)
+
+	result.Status = resp.StatusCode
+	result.ContentLength = int64(len(resp.Body))
+	result.BodySHA256 = fmt.Sprintf("%x", sha256.Sum256([]byte(resp.Body)))
+	result.Similarity = composite
+	if cfg.verbose {
+		result.Subscores = &sub
+	}
+	return result
 }
 
 // Makes a request to a given url changing its host header. Returns response
 // body as a string
-func doRequest(method string, u string, vhost string, cookieString string) (string, error) {
+func doRequest(method string, u string, vhost string, cookieString string) (ProbeResponse, error) {
 	req, err := http.NewRequest(method, u, strings.NewReader(""))
 	if err != nil {
-		return "", err
+		return ProbeResponse{}, err
 	}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/51.0.2704.103 Safari/537.36")
+	req.Header.Set("User-Agent", userAgent)
 	if len(cookieString) > 0 {
 		req.Header.Set("Cookie", cookieString)
 	}
@@ -268,17 +393,32 @@ func doRequest(method string, u string, vhost string, cookieString string) (stri
 
 	response, err := Client.Do(req)
 	if err != nil {
-		return "", err
+		return ProbeResponse{}, err
 	}
 	statusCode := response.StatusCode
 	if statusCode >= 300 && !ValidStatusCodes[statusCode] {
-		return "", fmt.Errorf("server error: status %d", response.StatusCode)
+		return ProbeResponse{}, fmt.Errorf("server error: status %d", response.StatusCode)
 	}
 
 	bodyBytes, err := ioutil.ReadAll(response.Body)
 	if err != nil {
-		return "", err
+		return ProbeResponse{}, err
+	}
+
+	headerNames := make([]string, 0, len(response.Header))
+	for name := range response.Header {
+		headerNames = append(headerNames, name)
+	}
+
+	var peerCertificates []*x509.Certificate
+	if response.TLS != nil {
+		peerCertificates = response.TLS.PeerCertificates
 	}
 
-	return string(bodyBytes), nil
+	return ProbeResponse{
+		StatusCode:       statusCode,
+		Body:             string(bodyBytes),
+		HeaderNames:      headerNames,
+		PeerCertificates: peerCertificates,
+	}, nil
 }
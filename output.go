@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// summaryTopK is how many top candidates by similarity are included in
+// the final summary record for -o json/jsonl.
+const summaryTopK = 5
+
+// resultSink renders ProbeResults as they complete. Exactly one sink
+// exists per run and it is the sole writer of stdout, so results from
+// concurrent workers never interleave.
+type resultSink interface {
+	write(result ProbeResult)
+	finish()
+}
+
+// newResultSink returns the sink backing the -o flag. format must be one
+// of "text", "json", "jsonl" or "csv".
+func newResultSink(format string) (resultSink, error) {
+	switch format {
+	case "text":
+		return &textSink{}, nil
+	case "jsonl":
+		return &jsonlSink{enc: json.NewEncoder(os.Stdout)}, nil
+	case "json":
+		return &jsonSink{}, nil
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		_ = w.Write([]string{"address", "vhost", "status", "similarity", "body_sha256", "content_length", "elapsed_ms", "error"})
+		return &csvSink{w: w}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q, expected text, json, jsonl or csv", format)
+	}
+}
+
+// textSink reproduces the original human-readable "address  NN.NN%"
+// output. Errored probes are dropped, as before; there is no summary.
+type textSink struct{}
+
+func (s *textSink) write(r ProbeResult) {
+	if r.Error != "" {
+		return
+	}
+	if r.Subscores != nil {
+		fmt.Printf("%-17s%.2f%% (body=%.2f headers=%.2f status=%.2f cert=%.2f)\n",
+			r.Address, r.Similarity*100, r.Subscores.Body, r.Subscores.Headers, r.Subscores.Status, r.Subscores.Cert)
+		return
+	}
+	fmt.Printf("%-17s%.2f%%\n", r.Address, r.Similarity*100)
+}
+
+func (s *textSink) finish() {}
+
+// resultSummary is the final record reported after a scan: the
+// candidates with the highest similarity score, most-similar first.
+type resultSummary struct {
+	Type string        `json:"type"`
+	TopK []ProbeResult `json:"top_k"`
+}
+
+func summarize(results []ProbeResult) resultSummary {
+	top := append([]ProbeResult(nil), results...)
+	sort.Slice(top, func(i, j int) bool { return top[i].Similarity > top[j].Similarity })
+	if len(top) > summaryTopK {
+		top = top[:summaryTopK]
+	}
+	return resultSummary{Type: "summary", TopK: top}
+}
+
+// jsonlSink emits one JSON object per candidate, followed by a final
+// summary record once the scan completes.
+type jsonlSink struct {
+	enc     *json.Encoder
+	results []ProbeResult
+}
+
+func (s *jsonlSink) write(r ProbeResult) {
+	s.results = append(s.results, r)
+	_ = s.enc.Encode(r)
+}
+
+func (s *jsonlSink) finish() {
+	_ = s.enc.Encode(summarize(s.results))
+}
+
+// jsonSink buffers every result and emits a single JSON object holding
+// the full result list plus a summary once the scan completes.
+type jsonSink struct {
+	results []ProbeResult
+}
+
+func (s *jsonSink) write(r ProbeResult) {
+	s.results = append(s.results, r)
+}
+
+func (s *jsonSink) finish() {
+	out := struct {
+		Results []ProbeResult `json:"results"`
+		Summary resultSummary `json:"summary"`
+	}{Results: s.results, Summary: summarize(s.results)}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(out)
+}
+
+// csvSink emits one row per candidate for consumption by tools like
+// csvkit, which can sort/filter on the similarity column themselves; no
+// summary row is appended.
+type csvSink struct {
+	w *csv.Writer
+}
+
+func (s *csvSink) write(r ProbeResult) {
+	_ = s.w.Write([]string{
+		r.Address,
+		r.VHost,
+		strconv.Itoa(r.Status),
+		strconv.FormatFloat(r.Similarity, 'f', 4, 64),
+		r.BodySHA256,
+		strconv.FormatInt(r.ContentLength, 10),
+		strconv.FormatInt(r.ElapsedMS, 10),
+		r.Error,
+	})
+}
+
+func (s *csvSink) finish() {
+	s.w.Flush()
+}
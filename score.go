@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/adrg/strutil"
+)
+
+// scoreWeights controls how heavily each signal contributes to a
+// candidate's composite score, set via -weights. This lets a composite
+// score be tuned for origins that serve a WAF challenge page with
+// identical HTML but different headers, or behind a CDN that injects an
+// edge banner, where body similarity alone misidentifies the origin.
+type scoreWeights struct {
+	Body    float64
+	Headers float64
+	Status  float64
+	Cert    float64
+}
+
+// defaultScoreWeights reproduces the previous behavior: score == body
+// similarity alone.
+var defaultScoreWeights = scoreWeights{Body: 1}
+
+// parseScoreWeights parses a "body=0.6,headers=0.2,status=0.1,cert=0.1"
+// style -weights value. An empty string yields defaultScoreWeights.
+func parseScoreWeights(s string) (scoreWeights, error) {
+	if len(s) == 0 {
+		return defaultScoreWeights, nil
+	}
+
+	var w scoreWeights
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return scoreWeights{}, fmt.Errorf("invalid -weights entry %q, expected key=value", pair)
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil {
+			return scoreWeights{}, fmt.Errorf("invalid -weights value %q: %w", kv[1], err)
+		}
+		switch strings.ToLower(strings.TrimSpace(kv[0])) {
+		case "body":
+			w.Body = value
+		case "headers":
+			w.Headers = value
+		case "status":
+			w.Status = value
+		case "cert":
+			w.Cert = value
+		default:
+			return scoreWeights{}, fmt.Errorf("unknown -weights key %q", kv[0])
+		}
+	}
+	return w, nil
+}
+
+// subscores holds each individual signal before weighting, reported
+// alongside the composite score in verbose mode.
+type subscores struct {
+	Body    float64 `json:"body"`
+	Headers float64 `json:"headers"`
+	Status  float64 `json:"status"`
+	Cert    float64 `json:"cert"`
+}
+
+func (s subscores) composite(w scoreWeights) float64 {
+	return s.Body*w.Body + s.Headers*w.Headers + s.Status*w.Status + s.Cert*w.Cert
+}
+
+// score computes the composite origin-likelihood score for candidate
+// against original, along with each signal's individual subscore. If
+// mustMatch is set and candidate's body doesn't match it, the composite
+// score is forced to 0 regardless of weights.
+func score(comparator strutil.StringMetric, weights scoreWeights, original, candidate ProbeResponse, vhost string, mustMatch *regexp.Regexp) (float64, subscores) {
+	sub := subscores{
+		Body:    strutil.Similarity(candidate.Body, original.Body, comparator),
+		Headers: headerJaccard(original.HeaderNames, candidate.HeaderNames),
+		Status:  statusScore(original.StatusCode, candidate.StatusCode),
+		Cert:    certScore(candidate.PeerCertificates, vhost),
+	}
+
+	if mustMatch != nil && !mustMatch.MatchString(candidate.Body) {
+		return 0, sub
+	}
+	return sub.composite(weights), sub
+}
+
+// headerJaccard is the Jaccard similarity between two sets of response
+// header names, compared case-insensitively.
+func headerJaccard(a, b []string) float64 {
+	setA := make(map[string]struct{}, len(a))
+	for _, h := range a {
+		setA[strings.ToLower(h)] = struct{}{}
+	}
+	setB := make(map[string]struct{}, len(b))
+	for _, h := range b {
+		setB[strings.ToLower(h)] = struct{}{}
+	}
+	if len(setA) == 0 && len(setB) == 0 {
+		return 1
+	}
+
+	intersection := 0
+	for h := range setA {
+		if _, ok := setB[h]; ok {
+			intersection++
+		}
+	}
+	union := len(setA) + len(setB) - intersection
+	if union == 0 {
+		return 0
+	}
+	return float64(intersection) / float64(union)
+}
+
+func statusScore(original, candidate int) float64 {
+	if original == candidate {
+		return 1
+	}
+	return 0
+}
+
+// certScore reports whether any of the candidate's presented TLS
+// certificates cover vhost via its Subject Alternative Names. It's 0
+// when the candidate wasn't probed over TLS, presented no certificate,
+// or the engine doesn't expose peer certificates (the fasthttp engine,
+// currently).
+func certScore(certs []*x509.Certificate, vhost string) float64 {
+	host := vhost
+	if h, _, err := net.SplitHostPort(vhost); err == nil {
+		host = h
+	}
+	for _, cert := range certs {
+		if cert.VerifyHostname(host) == nil {
+			return 1
+		}
+	}
+	return 0
+}